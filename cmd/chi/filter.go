@@ -0,0 +1,409 @@
+// filter.go implements the composable per-sink transformation pipeline that
+// replaces the old boolean bare/care mode: --strip-ansi, --strip-osc,
+// --strip-cursor, --downgrade-truecolor, --html and --json-lines, plus a
+// registry so third parties can add filters of their own. -b/--bare and
+// -c/--care remain as shorthand for the empty chain and the [strip-ansi]
+// chain, respectively.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Filter transforms one chunk of a sink's stream. carry is the filter's own
+// private state between calls for this sink (e.g. an escape sequence split
+// across chunks) — *carry starts nil and is whatever the filter last left
+// it as. A nil in is the end-of-stream signal: the filter must return
+// whatever it was holding back in *carry (fully decoded, since nothing more
+// will ever arrive to complete it) and leave *carry nil.
+type Filter func(in []byte, carry *[]byte) []byte
+
+var (
+	filterRegistryMu sync.RWMutex
+	filterRegistry   = map[string]Filter{}
+)
+
+// RegisterFilter registers a named filter, so third parties (and --html,
+// --json-lines, etc. themselves) can be composed into a sink's chain via
+// FILE_OPTS. Registering under an existing name replaces it.
+func RegisterFilter(name string, f Filter) {
+	filterRegistryMu.Lock()
+	defer filterRegistryMu.Unlock()
+
+	filterRegistry[name] = f
+}
+
+func lookupFilter(name string) (Filter, bool) {
+	filterRegistryMu.RLock()
+	defer filterRegistryMu.RUnlock()
+
+	f, ok := filterRegistry[name]
+	return f, ok
+}
+
+func init() {
+	RegisterFilter("strip-ansi", filterStripANSI)
+	RegisterFilter("strip-osc", filterStripOSC)
+	RegisterFilter("strip-cursor", filterStripCursor)
+	RegisterFilter("downgrade-truecolor", filterDowngradeTruecolor)
+	RegisterFilter("html", filterHTML)
+	RegisterFilter("json-lines", filterJSONLines)
+}
+
+// resolveFilterChain looks up each name in order, so a sink's chain runs in
+// the order its flags were given on the command line.
+func resolveFilterChain(names []string) ([]Filter, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	chain := make([]Filter, len(names))
+
+	for i, name := range names {
+		f, ok := lookupFilter(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown filter: %s", name)
+		}
+		chain[i] = f
+	}
+
+	return chain, nil
+}
+
+// applyFilterChain runs in through every stage in order. carries must have
+// the same length as filters (one slot per stage).
+func applyFilterChain(filters []Filter, carries [][]byte, in []byte) []byte {
+	data := in
+	for i, f := range filters {
+		data = f(data, &carries[i])
+	}
+
+	return data
+}
+
+// flushFilterChain drains every stage at end-of-stream: each stage's
+// already-flushed output is fed into the next stage as ordinary input
+// before that next stage is itself flushed, so a multi-stage chain (e.g.
+// --strip-ansi --json-lines) still emits its last, newline-less line.
+func flushFilterChain(filters []Filter, carries [][]byte) []byte {
+	var data []byte
+
+	for i, f := range filters {
+		if len(data) > 0 {
+			data = f(data, &carries[i])
+		}
+		data = append(data, f(nil, &carries[i])...)
+	}
+
+	return data
+}
+
+// --- strip-ansi --------------------------------------------------------
+
+// filterStripANSI strips ANSI CSI escape sequences, holding back a
+// possibly-incomplete sequence at a chunk boundary (see stripANSICarry in
+// main.go, which this reuses for both --binary mode and here).
+func filterStripANSI(in []byte, carry *[]byte) []byte {
+	return stripANSICarry(in, carry, in == nil)
+}
+
+// --- strip-osc -----------------------------------------------------------
+
+// oscRegExpr matches OSC escapes: ESC ] ... terminated by BEL or ST (ESC \).
+var oscRegExpr = regexp.MustCompile("\x1b\\][^\x07\x1b]*(\x07|\x1b\\\\)")
+
+func filterStripOSC(in []byte, carry *[]byte) []byte {
+	buf := append(*carry, in...)
+	*carry = nil
+
+	if in != nil {
+		if idx := bytes.LastIndex(buf, []byte("\x1b]")); idx >= 0 {
+			tail := buf[idx:]
+			if !oscRegExpr.Match(tail) {
+				*carry = append([]byte(nil), tail...)
+				buf = buf[:idx]
+			}
+		}
+	}
+
+	return oscRegExpr.ReplaceAll(buf, nil)
+}
+
+// --- strip-cursor ----------------------------------------------------------
+
+// cursorRegExpr matches CUP (H/f), EL (K) and ED (J) only, leaving other CSI
+// sequences (e.g. SGR color codes) untouched.
+var cursorRegExpr = regexp.MustCompile(`\x1b\[[0-9;]*[HfKJ]`)
+
+func filterStripCursor(in []byte, carry *[]byte) []byte {
+	buf := append(*carry, in...)
+	*carry = nil
+
+	if in != nil {
+		if idx := bytes.LastIndexByte(buf, 0x1b); idx >= 0 {
+			tail := buf[idx:]
+			// Hold back only if tail isn't a complete CSI sequence of any
+			// kind yet; a complete-but-uninteresting one (e.g. SGR) is left
+			// in the output untouched rather than buffered forever.
+			if !ansiEscapeRegExpr.Match(tail) {
+				*carry = append([]byte(nil), tail...)
+				buf = buf[:idx]
+			}
+		}
+	}
+
+	return cursorRegExpr.ReplaceAll(buf, nil)
+}
+
+// --- downgrade-truecolor ---------------------------------------------------
+
+// sgrRegExpr matches a whole SGR sequence so its parameter list can be
+// rewritten in place.
+var sgrRegExpr = regexp.MustCompile(`\x1b\[([0-9;]*)m`)
+
+func filterDowngradeTruecolor(in []byte, carry *[]byte) []byte {
+	buf := append(*carry, in...)
+	*carry = nil
+
+	if in != nil {
+		if idx := bytes.LastIndexByte(buf, 0x1b); idx >= 0 {
+			tail := buf[idx:]
+			if !ansiEscapeRegExpr.Match(tail) {
+				*carry = append([]byte(nil), tail...)
+				buf = buf[:idx]
+			}
+		}
+	}
+
+	return sgrRegExpr.ReplaceAllFunc(buf, func(m []byte) []byte {
+		params := sgrRegExpr.FindSubmatch(m)[1]
+		return []byte("\x1b[" + downgradeSGRParams(string(params)) + "m")
+	})
+}
+
+// downgradeSGRParams rewrites any 38;2;r;g;b / 48;2;r;g;b (24-bit) triplet
+// in an SGR parameter list into the nearest 38;5;N / 48;5;N (256-color)
+// equivalent; every other parameter passes through unchanged.
+func downgradeSGRParams(params string) string {
+	if params == "" {
+		return params
+	}
+
+	parts := strings.Split(params, ";")
+	out := make([]string, 0, len(parts))
+
+	for i := 0; i < len(parts); i++ {
+		if (parts[i] == "38" || parts[i] == "48") && i+4 < len(parts) && parts[i+1] == "2" {
+			r, _ := strconv.Atoi(parts[i+2])
+			g, _ := strconv.Atoi(parts[i+3])
+			b, _ := strconv.Atoi(parts[i+4])
+
+			out = append(out, parts[i], "5", strconv.Itoa(rgbTo256(r, g, b)))
+			i += 4
+			continue
+		}
+
+		out = append(out, parts[i])
+	}
+
+	return strings.Join(out, ";")
+}
+
+// rgbTo256 maps a 24-bit color to the nearest index in the standard
+// xterm 256-color cube (16-231) or grayscale ramp (232-255).
+func rgbTo256(r, g, b int) int {
+	if r == g && g == b {
+		switch {
+		case r < 8:
+			return 16
+		case r > 248:
+			return 231
+		default:
+			return 232 + (r-8)*24/247
+		}
+	}
+
+	toIdx := func(v int) int { return (v * 5) / 255 }
+	return 16 + 36*toIdx(r) + 6*toIdx(g) + toIdx(b)
+}
+
+// --- html ------------------------------------------------------------------
+
+// htmlState is the --html filter's per-sink carry, encoded as
+// "<openStyle>\x00<pending incomplete-escape bytes>" since Filter only
+// gives us a single []byte of storage between calls.
+type htmlState struct {
+	openStyle string
+	pending   []byte
+}
+
+func decodeHTMLState(carry []byte) htmlState {
+	if carry == nil {
+		return htmlState{}
+	}
+
+	idx := bytes.IndexByte(carry, 0)
+	if idx < 0 {
+		return htmlState{pending: carry}
+	}
+
+	return htmlState{openStyle: string(carry[:idx]), pending: carry[idx+1:]}
+}
+
+func (s htmlState) encode() []byte {
+	return append([]byte(s.openStyle+"\x00"), s.pending...)
+}
+
+// filterHTML converts SGR runs into <span style="..."> for HTML log
+// capture, escaping ordinary text and closing/reopening spans as the style
+// changes.
+func filterHTML(in []byte, carry *[]byte) []byte {
+	state := decodeHTMLState(*carry)
+
+	if in == nil {
+		var out bytes.Buffer
+		out.Write(escapeHTMLText(state.pending))
+		if state.openStyle != "" {
+			out.WriteString("</span>")
+		}
+		*carry = nil
+		return out.Bytes()
+	}
+
+	buf := append(state.pending, in...)
+
+	var out bytes.Buffer
+	last := 0
+
+	for _, loc := range sgrRegExpr.FindAllSubmatchIndex(buf, -1) {
+		out.Write(escapeHTMLText(buf[last:loc[0]]))
+
+		style := sgrParamsToCSS(string(buf[loc[2]:loc[3]]))
+
+		if state.openStyle != "" {
+			out.WriteString("</span>")
+		}
+		if style != "" {
+			fmt.Fprintf(&out, `<span style="%s">`, style)
+		}
+		state.openStyle = style
+
+		last = loc[1]
+	}
+
+	tail := buf[last:]
+	if idx := bytes.LastIndexByte(tail, 0x1b); idx >= 0 && !ansiEscapeRegExpr.Match(tail[idx:]) {
+		out.Write(escapeHTMLText(tail[:idx]))
+		state.pending = append([]byte(nil), tail[idx:]...)
+	} else {
+		out.Write(escapeHTMLText(tail))
+		state.pending = nil
+	}
+
+	*carry = state.encode()
+
+	return out.Bytes()
+}
+
+func escapeHTMLText(b []byte) []byte {
+	if len(b) == 0 {
+		return nil
+	}
+
+	return []byte(html.EscapeString(string(b)))
+}
+
+var ansiColorNames = [8]string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+// sgrParamsToCSS covers the common SGR codes (reset, bold, italic,
+// underline, the 8 basic fg/bg colors); anything else is ignored rather
+// than guessed at.
+func sgrParamsToCSS(params string) string {
+	var css []string
+
+	for _, p := range strings.Split(params, ";") {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case n == 0:
+			return ""
+		case n == 1:
+			css = append(css, "font-weight:bold")
+		case n == 3:
+			css = append(css, "font-style:italic")
+		case n == 4:
+			css = append(css, "text-decoration:underline")
+		case n >= 30 && n <= 37:
+			css = append(css, "color:"+ansiColorNames[n-30])
+		case n >= 40 && n <= 47:
+			css = append(css, "background-color:"+ansiColorNames[n-40])
+		}
+	}
+
+	return strings.Join(css, ";")
+}
+
+// --- json-lines --------------------------------------------------------
+
+type jsonLineRecord struct {
+	TS     string `json:"ts"`
+	Stream string `json:"stream"`
+	Text   string `json:"text"`
+}
+
+// filterJSONLines wraps each complete line as a JSON object, carrying over
+// an unterminated trailing line to the next chunk (or to end-of-stream).
+func filterJSONLines(in []byte, carry *[]byte) []byte {
+	buf := append(*carry, in...)
+	*carry = nil
+
+	if in == nil {
+		if len(buf) == 0 {
+			return nil
+		}
+		return encodeJSONLine(buf)
+	}
+
+	var out bytes.Buffer
+
+	for {
+		idx := bytes.IndexByte(buf, '\n')
+		if idx < 0 {
+			break
+		}
+
+		out.Write(encodeJSONLine(buf[:idx]))
+		buf = buf[idx+1:]
+	}
+
+	*carry = append([]byte(nil), buf...)
+
+	return out.Bytes()
+}
+
+func encodeJSONLine(line []byte) []byte {
+	rec := jsonLineRecord{
+		TS:     time.Now().UTC().Format(time.RFC3339Nano),
+		Stream: "stdout",
+		Text:   string(bytes.TrimSuffix(line, []byte("\r"))),
+	}
+
+	encoded, err := json.Marshal(rec)
+	if err != nil {
+		return nil
+	}
+
+	return append(encoded, '\n')
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestFilterJSONLinesFlushesTrailingLine covers the bug class reported
+// against runLines: a final, newline-less line must still be emitted by
+// flushFilterChain, not dropped because the stream ended before '\n'.
+func TestFilterJSONLinesFlushesTrailingLine(t *testing.T) {
+	var carry []byte
+
+	out := filterJSONLines([]byte("first\nsecond\nthird (no nl)"), &carry)
+	if strings.Count(string(out), "\n") != 2 {
+		t.Fatalf("expected exactly 2 complete lines emitted before flush, got: %q", out)
+	}
+	if len(carry) == 0 {
+		t.Fatalf("expected trailing unterminated line held in carry")
+	}
+
+	flushed := filterJSONLines(nil, &carry)
+	if len(flushed) == 0 {
+		t.Fatalf("expected flush to emit the trailing line, got nothing")
+	}
+	if carry != nil {
+		t.Fatalf("expected carry drained after flush, got %q", carry)
+	}
+
+	var rec jsonLineRecord
+	if err := json.Unmarshal(flushed, &rec); err != nil {
+		t.Fatalf("flushed output isn't valid JSON: %v (%q)", err, flushed)
+	}
+	if rec.Text != "third (no nl)" {
+		t.Fatalf("got text %q, want %q", rec.Text, "third (no nl)")
+	}
+}
+
+// TestFlushFilterChainMultiStage checks that a multi-stage chain (matching
+// --strip-ansi --json-lines) still drains its last record: strip-ansi's
+// flush output must be fed into json-lines as ordinary input before
+// json-lines is itself flushed.
+func TestFlushFilterChainMultiStage(t *testing.T) {
+	filters, err := resolveFilterChain([]string{"strip-ansi", "json-lines"})
+	if err != nil {
+		t.Fatalf("resolveFilterChain: %v", err)
+	}
+	carries := make([][]byte, len(filters))
+
+	out := applyFilterChain(filters, carries, []byte("one\n\x1b[31mtwo (no nl)"))
+	out = append(out, flushFilterChain(filters, carries)...)
+
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 JSON records, got %d: %q", len(lines), out)
+	}
+
+	var last jsonLineRecord
+	if err := json.Unmarshal([]byte(lines[1]), &last); err != nil {
+		t.Fatalf("last record isn't valid JSON: %v (%q)", err, lines[1])
+	}
+	if last.Text != "two (no nl)" {
+		t.Fatalf("got text %q, want ANSI-stripped %q", last.Text, "two (no nl)")
+	}
+}
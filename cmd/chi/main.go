@@ -4,19 +4,57 @@
 //
 // OPTIONS:
 //   -i, --ignore-interrupts   ignore interrupt signals
+//   -B, --binary              binary-safe mode: read fixed-size chunks instead of lines
+//       --buffer-size N[K|M]  chunk size for --binary mode (default 64K)
+//       --parallel[=N]        write to sinks concurrently, N at a time (default NumCPU)
+//       --max-buffer=SIZE     total in-flight bytes allowed across sinks (default 512K)
+//       --interactive         readline REPL when stdout is a TTY (no-op otherwise)
 //       --help                display this help and exit
 //       --version             output version information and exit
 //
 // FILE_OPTS (apply to the next FILE only):
-//   -a, --append              append to FILE (do not overwrite)
-//   -b, --bare                write input as-is (keep ANSI escapes)
-//   -c, --care                strip ANSI escapes (plain text)
+//   -a, --append               append to FILE (do not overwrite)
+//   -b, --bare                 write input as-is (shorthand for an empty filter chain)
+//   -c, --care                 strip ANSI escapes (shorthand for --strip-ansi)
+//       --strip-ansi           strip ANSI CSI escape sequences
+//       --strip-osc            strip OSC escape sequences (titles, hyperlinks, ...)
+//       --strip-cursor         strip cursor-movement/erase sequences only (CUP/EL/ED)
+//       --downgrade-truecolor  rewrite 24-bit SGR color codes to the nearest 256-color code
+//       --html                 render SGR runs as <span style="..."> for HTML capture
+//       --json-lines           wrap each line as a {"ts","stream","text"} JSON object
+//       --rotate-size=SIZE     rotate FILE once it reaches SIZE (e.g. 10M)
+//       --rotate-interval=DUR  rotate FILE once DUR has elapsed since it was opened (e.g. 1h)
+//       --rotate-keep=N        prune to the newest N archives (default: keep all)
+//       --rotate-scheme=SCHEME "timestamp" (default) or "numeric" archive naming
+//       --rotate-compress      gzip archived segments
 //
 // Copy standard input to each FILE, and also to standard output.
 //
 // Notes:
 // - Output to stdout is always "as-is" (keeps ANSI escapes), so your terminal stays decorated.
-// - For FILEs, default mode is "--bare" unless "--care" is specified for that FILE.
+// - Each FILE has its own filter chain, applied in the order its flags were given
+//   (e.g. "--strip-ansi --json-lines FILE" strips escapes, then wraps each line as
+//   JSON). With no filter flags a FILE gets the empty chain, i.e. --bare. See
+//   filter.go for the full set and RegisterFilter for adding more.
+// - In --binary mode, input is never split on newlines: it is read as fixed-size
+//   chunks via io.ReadFull and fanned out unchanged. Filters that need it (e.g.
+//   --strip-ansi) carry partial escape sequences across chunk boundaries.
+// - With --parallel, a slow sink (e.g. a network-mounted file) no longer stalls
+//   stdout or the other sinks; a failing sink is dropped with a stderr
+//   diagnostic instead of aborting the whole process (see pool.go).
+// - FILE may be a plain path, or a "scheme://..." sink URI: file:// (?append=1,
+//   ?mode=0600), tcp://host:port and unix://path (?retry=1 to reconnect with
+//   backoff on write error), udp://host:port (one datagram per write), http(s)://
+//   (streamed as a chunked POST body), and fd://N. See sink.go and RegisterScheme
+//   for adding more.
+// - --rotate-* applies to file sinks only (plain paths and file:// URIs); it is
+//   ignored for other sink schemes. Rotation happens on the archived file, i.e.
+//   FILE itself is always the live segment (see rotate.go).
+// - --interactive prints incoming lines above the prompt instead of clobbering
+//   it, and accepts ":flush", ":rotate <sink>", ":pause <sink>", ":resume <sink>",
+//   ":add <path>" and ":drop <sink>" to manage sinks live (see repl.go). Ctrl+C
+//   cancels just the current prompt line; it is never swallowed process-wide the
+//   way --ignore-interrupts does outside of --interactive.
 
 package main
 
@@ -25,43 +63,73 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 )
 
 const (
 	appName    = "chi"
 	appVersion = "0.1.0"
+
+	// defaultBufferSize is the chunk size used by --binary mode when
+	// --buffer-size is not given.
+	defaultBufferSize = 64 * 1024
 )
 
 // ANSI CSI escape sequence matcher (fairly general).
 // Examples: ESC [ 31m, ESC [ 0m, ESC [ 2K, ESC [ 1;32m, etc.
 var ansiEscapeRegExpr = regexp.MustCompile(`\x1b\[[0-9;]*[ -/]*[@-~]`)
 
-type fileMode int
-
-const (
-	// keep ANSI
-	modeBare fileMode = iota
-	
-	// strip ANSI
-	modeCare
-	
-	// I'm planning the `rare` for rhymy joking.
-)
-
 type pendingFileOpts struct {
 	append bool
-	mode   fileMode
+
+	// filterNames is the ordered chain of registered filter names that will
+	// apply to the next FILE (see filter.go). nil means the empty chain
+	// ("bare": write input as-is); -c/--care is shorthand for
+	// []string{"strip-ansi"}.
+	filterNames []string
+
+	rotate rotateConfig
 }
 
 type targetFile struct {
-	path   string
-	append bool
-	mode   fileMode
+	path        string
+	append      bool
+	filterNames []string
+	rotate      rotateConfig
+}
+
+// options holds the global (non-per-file) settings parsed from argv.
+type options struct {
+	ignoreInterrupts bool
+
+	// binary selects fixed-size chunk reads (io.ReadFull) instead of the
+	// default line-oriented ReadBytes('\n') loop.
+	binary bool
+
+	// bufferSize is the chunk size used when binary is set.
+	bufferSize int
+
+	// parallel enables the sinkPool fan-out instead of writing to sinks
+	// serially in the read loop.
+	parallel bool
+
+	// parallelCap is the --parallel worker cap (concurrently-active writes).
+	parallelCap int
+
+	// maxBuffer is the --max-buffer total in-flight byte cap for the pool.
+	maxBuffer int
+
+	// interactive enables the readline-based REPL (repl.go) when stdout is
+	// a TTY; see isStdoutTTY.
+	interactive bool
 }
 
 func printHelp(whereToWrite *os.File) {
@@ -69,15 +137,37 @@ func printHelp(whereToWrite *os.File) {
 
 OPTIONS:
   -i, --ignore-interrupts   ignore interrupt signals
+  -B, --binary              binary-safe mode: read fixed-size chunks instead of lines
+      --buffer-size N[K|M]  chunk size for --binary mode (default 64K)
+      --parallel[=N]        write to sinks concurrently, N at a time (default NumCPU)
+      --max-buffer=SIZE     total in-flight bytes allowed across sinks (default 512K)
+      --interactive         readline REPL when stdout is a TTY (no-op otherwise)
       --help                display this help and exit
       --version             output version information and exit
 
 FILE_OPTS (apply to the next FILE only):
-  -a, --append              append to FILE (do not overwrite)
-  -b, --bare                write input as-is (keep ANSI escapes)
-  -c, --care                strip ANSI escapes (plain text)
+  -a, --append               append to FILE (do not overwrite)
+  -b, --bare                 write input as-is (shorthand for an empty filter chain)
+  -c, --care                 strip ANSI escapes (shorthand for --strip-ansi)
+      --strip-ansi           strip ANSI CSI escape sequences
+      --strip-osc            strip OSC escape sequences (titles, hyperlinks, ...)
+      --strip-cursor         strip cursor-movement/erase sequences only (CUP/EL/ED)
+      --downgrade-truecolor  rewrite 24-bit SGR color codes to the nearest 256-color code
+      --html                 render SGR runs as <span style="..."> for HTML capture
+      --json-lines           wrap each line as a {"ts","stream","text"} JSON object
+      --rotate-size=SIZE     rotate FILE once it reaches SIZE (e.g. 10M)
+      --rotate-interval=DUR  rotate FILE once DUR has elapsed since it was opened (e.g. 1h)
+      --rotate-keep=N        prune to the newest N archives (default: keep all)
+      --rotate-scheme=SCHEME "timestamp" (default) or "numeric" archive naming
+      --rotate-compress      gzip archived segments
 
 Copy standard input to each FILE, and also to standard output.
+
+FILE may be a plain path, or a "scheme://..." sink URI: file://, tcp://,
+unix://, udp://, http(s)://, fd://N.
+
+In --interactive mode, type ":flush", ":rotate <sink>", ":pause <sink>",
+":resume <sink>", ":add <path>" or ":drop <sink>" to manage sinks live.
 `, appName)
 }
 
@@ -85,69 +175,206 @@ func printVersion(whereToWrite *os.File) {
 	fmt.Fprintf(whereToWrite, "%s %s\n", appName, appVersion)
 }
 
+// parseSize parses a size argument of the form "N", "NK" or "NM" (case
+// insensitive, e.g. "64K", "4M", "1024") into a byte count.
+func parseSize(s string) (int, error) {
+	if s == "" {
+		return 0, fmt.Errorf("empty size")
+	}
+
+	mul := 1
+	numPart := s
+
+	switch s[len(s)-1] {
+	case 'k', 'K':
+		mul = 1024
+		numPart = s[:len(s)-1]
+	case 'm', 'M':
+		mul = 1024 * 1024
+		numPart = s[:len(s)-1]
+	}
+
+	n, err := strconv.Atoi(numPart)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+
+	return n * mul, nil
+}
+
 // parseArgs parses argv (excluding argv[0]).
 // Global options may appear anywhere (currently, there are no promises for the future; keep it leading for future compatibilities).
 // FILE_OPTS apply only to the next FILE and are reset after consuming that FILE.
 //
-// Default per-file mode is "bare" (keep ANSI escapes) unless --care is specified.
-func parseArgs(args []string) (ignoreInterrupts bool, targetFiles []targetFile, err error) {
+// Default per-file filter chain is empty ("bare", keep ANSI escapes) unless
+// --care or another filter flag is given.
+func parseArgs(args []string) (opts options, targetFiles []targetFile, err error) {
+	opts.bufferSize = defaultBufferSize
+	opts.parallelCap = runtime.NumCPU()
+	opts.maxBuffer = defaultMaxBuffer
+
+	maxBufferSet := false
+
 	pend := pendingFileOpts{
 		append: false,
-		mode:   modeBare,
 	}
-	
+
 	consumeFile := func(path string) {
 		targetFiles = append(targetFiles, targetFile{
-			path:   path,
-			append: pend.append,
-			mode:   pend.mode,
+			path:        path,
+			append:      pend.append,
+			filterNames: pend.filterNames,
+			rotate:      pend.rotate,
 		})
-		
+
 		// Reset (FILE_OPTS apply to the next FILE only)
 		pend = pendingFileOpts{
 			append: false,
-			mode:   modeBare,
 		}
 	}
-	
+
 	// Helper: expand short option clusters like -abc or -iab
 	handleShortCluster := func(cluster string) error {
 		// cluster does not include the leading "-"
 		if cluster == "" {
 			return fmt.Errorf("invalid option: '-'")
 		}
-		
+
 		for _, ch := range cluster {
 			switch ch {
 			case 'i':
-				ignoreInterrupts = true
+				opts.ignoreInterrupts = true
+			case 'B':
+				opts.binary = true
 			case 'a':
 				pend.append = true
 			case 'b':
-				pend.mode = modeBare
+				pend.filterNames = nil
 			case 'c':
-				pend.mode = modeCare
+				pend.filterNames = []string{"strip-ansi"}
 			default:
 				return fmt.Errorf("unknown option: -%c", ch)
 			}
 		}
-		
+
 		return nil
 	}
-	
+
 	// Walk tokens left-to-right
 	for i := 0; i < len(args); i++ {
 		token := args[i]
-		
+
 		if token == "--" {
 			// Everything after "--" is treated as FILEs (no more option parsing).
 			for j := i + 1; j < len(args); j++ {
 				consumeFile(args[j])
 			}
-			
-			return ignoreInterrupts, targetFiles, nil
+
+			return opts, targetFiles, nil
+		}
+
+		if strings.HasPrefix(token, "--buffer-size") {
+			var value string
+			if token == "--buffer-size" {
+				if i+1 >= len(args) {
+					return options{}, nil, fmt.Errorf("--buffer-size requires an argument")
+				}
+				i++
+				value = args[i]
+			} else if strings.HasPrefix(token, "--buffer-size=") {
+				value = strings.TrimPrefix(token, "--buffer-size=")
+			} else {
+				return options{}, nil, fmt.Errorf("unknown option: %s", token)
+			}
+
+			size, sizeErr := parseSize(value)
+			if sizeErr != nil {
+				return options{}, nil, fmt.Errorf("--buffer-size: %w", sizeErr)
+			}
+			opts.bufferSize = size
+			continue
 		}
-		
+
+		if strings.HasPrefix(token, "--max-buffer") {
+			var value string
+			if strings.HasPrefix(token, "--max-buffer=") {
+				value = strings.TrimPrefix(token, "--max-buffer=")
+			} else {
+				return options{}, nil, fmt.Errorf("unknown option: %s", token)
+			}
+
+			size, sizeErr := parseSize(value)
+			if sizeErr != nil {
+				return options{}, nil, fmt.Errorf("--max-buffer: %w", sizeErr)
+			}
+			opts.maxBuffer = size
+			maxBufferSet = true
+			continue
+		}
+
+		if strings.HasPrefix(token, "--parallel") {
+			switch {
+			case token == "--parallel":
+				opts.parallel = true
+			case strings.HasPrefix(token, "--parallel="):
+				n, convErr := strconv.Atoi(strings.TrimPrefix(token, "--parallel="))
+				if convErr != nil || n <= 0 {
+					return options{}, nil, fmt.Errorf("--parallel: invalid worker count: %s", token)
+				}
+				opts.parallel = true
+				opts.parallelCap = n
+			default:
+				return options{}, nil, fmt.Errorf("unknown option: %s", token)
+			}
+			continue
+		}
+
+		if strings.HasPrefix(token, "--rotate-size=") {
+			size, sizeErr := parseSize(strings.TrimPrefix(token, "--rotate-size="))
+			if sizeErr != nil {
+				return options{}, nil, fmt.Errorf("--rotate-size: %w", sizeErr)
+			}
+			pend.rotate.enabled = true
+			pend.rotate.sizeBytes = int64(size)
+			continue
+		}
+
+		if strings.HasPrefix(token, "--rotate-interval=") {
+			d, durErr := time.ParseDuration(strings.TrimPrefix(token, "--rotate-interval="))
+			if durErr != nil {
+				return options{}, nil, fmt.Errorf("--rotate-interval: %w", durErr)
+			}
+			pend.rotate.enabled = true
+			pend.rotate.interval = d
+			continue
+		}
+
+		if strings.HasPrefix(token, "--rotate-keep=") {
+			n, convErr := strconv.Atoi(strings.TrimPrefix(token, "--rotate-keep="))
+			if convErr != nil || n < 0 {
+				return options{}, nil, fmt.Errorf("--rotate-keep: invalid count: %s", token)
+			}
+			pend.rotate.keep = n
+			continue
+		}
+
+		if strings.HasPrefix(token, "--rotate-scheme=") {
+			switch v := strings.TrimPrefix(token, "--rotate-scheme="); v {
+			case "numeric":
+				pend.rotate.scheme = rotateSchemeNumeric
+			case "timestamp":
+				pend.rotate.scheme = rotateSchemeTimestamp
+			default:
+				return options{}, nil, fmt.Errorf("--rotate-scheme: unknown scheme %q", v)
+			}
+			continue
+		}
+
+		if token == "--rotate-compress" {
+			pend.rotate.compress = true
+			continue
+		}
+
 		if strings.HasPrefix(token, "--") {
 			switch token {
 			case "--help":
@@ -157,169 +384,349 @@ func parseArgs(args []string) (ignoreInterrupts bool, targetFiles []targetFile,
 				printVersion(os.Stdout)
 				os.Exit(0)
 			case "--ignore-interrupts":
-				ignoreInterrupts = true
+				opts.ignoreInterrupts = true
+			case "--binary":
+				opts.binary = true
+			case "--interactive":
+				opts.interactive = true
 			case "--append":
 				pend.append = true
 			case "--bare":
-				pend.mode = modeBare
+				pend.filterNames = nil
 			case "--care":
-				pend.mode = modeCare
+				pend.filterNames = []string{"strip-ansi"}
+			case "--strip-ansi", "--strip-osc", "--strip-cursor", "--downgrade-truecolor", "--html", "--json-lines":
+				pend.filterNames = append(pend.filterNames, strings.TrimPrefix(token, "--"))
 			default:
-				return false, nil, fmt.Errorf("unknown option: %s", token)
+				return options{}, nil, fmt.Errorf("unknown option: %s", token)
 			}
 			continue
 		}
-		
+
 		if strings.HasPrefix(token, "-") && (token != "-") {
 			// short option or cluster
 			if err := handleShortCluster(strings.TrimPrefix(token, "-")); err != nil {
-				return false, nil, err
+				return options{}, nil, err
 			}
-			
+
 			continue
 		}
-		
+
 		// Not an option: treat as FILE
 		consumeFile(token)
 	}
-	
-	return ignoreInterrupts, targetFiles, nil
+
+	// A single chunk larger than --max-buffer can never be acquired from
+	// byteSem (see sinkPool.broadcast), which would hang the process
+	// forever instead of erroring. If the user left --max-buffer at its
+	// default, grow it to fit --buffer-size; if they set it explicitly
+	// too small, fail fast instead of deadlocking later.
+	if maxBufferSet {
+		if opts.maxBuffer < opts.bufferSize {
+			return options{}, nil, fmt.Errorf("--max-buffer (%d) must be >= --buffer-size (%d)", opts.maxBuffer, opts.bufferSize)
+		}
+	} else if opts.maxBuffer < opts.bufferSize {
+		opts.maxBuffer = opts.bufferSize
+	}
+
+	return opts, targetFiles, nil
 }
 
-func openTarget(path string, appendMode bool) (*os.File, error) {
-	flags := os.O_CREATE | os.O_WRONLY
-	
-	if appendMode {
-		flags |= os.O_APPEND
-	} else {
-		flags |= os.O_TRUNC
+// stripANSICarry strips ANSI CSI escape sequences from data, holding back a
+// possibly-incomplete escape sequence at the end of the buffer in *carry so
+// it can be completed by the next chunk. This lets --care sinks strip
+// sequences that straddle a chunk boundary in --binary mode (e.g. ESC at the
+// end of chunk N, "[31m" at the start of chunk N+1).
+//
+// Pass final=true at EOF: any bytes still held back are flushed through
+// as-is, since there is nothing left to complete them.
+func stripANSICarry(data []byte, carry *[]byte, final bool) []byte {
+	buf := append(*carry, data...)
+	*carry = nil
+
+	if !final {
+		if idx := bytes.LastIndexByte(buf, 0x1b); idx >= 0 {
+			tail := buf[idx:]
+			if !ansiEscapeRegExpr.Match(tail) {
+				// Either a lone ESC or the start of a sequence whose
+				// terminator hasn't arrived yet; hold it back.
+				*carry = append([]byte(nil), tail...)
+				buf = buf[:idx]
+			}
+		}
+	}
+
+	return ansiEscapeRegExpr.ReplaceAll(buf, nil)
+}
+
+type sink struct {
+	filters []Filter
+	carries [][]byte // one carry slot per filters entry
+	writer  *bufio.Writer
+	closer  Sink
+}
+
+// runLines is the default, line-oriented copy loop (ReadBytes('\n')). If
+// pool is non-nil, sink writes are fanned out concurrently instead of
+// written serially in this loop.
+func runLines(stdin *bufio.Reader, stdout *bufio.Writer, sinks []sink, pool *sinkPool) error {
+	for {
+		// keeps '\n' if present. On EOF, ReadBytes returns whatever trailing,
+		// newline-less bytes it had buffered together with the error, so that
+		// final segment must still be written before the error is handled.
+		line, readErr := stdin.ReadBytes('\n')
+
+		if len(line) > 0 {
+			// Always write raw to stdout (keeping ANSI escapes)
+			if _, writeErr := stdout.Write(line); writeErr != nil {
+				return fmt.Errorf("stdout write error: %w", writeErr)
+			}
+
+			if pool != nil {
+				pool.broadcast(sinkOutputs(sinks, line))
+			} else {
+				// Write to each file sink, through its own filter chain
+				for _, s := range sinks {
+					out := applyFilterChain(s.filters, s.carries, line)
+
+					if _, writeErr := s.writer.Write(out); writeErr != nil {
+						return fmt.Errorf("file write error: %w", writeErr)
+					}
+				}
+			}
+		}
+
+		if readErr != nil {
+			// EOF is normal termination; anything else is an error.
+			if errors.Is(readErr, os.ErrClosed) || readErr.Error() == "EOF" {
+				return flushSinkFilters(sinks, pool)
+			}
+
+			return fmt.Errorf("read error: %w", readErr)
+		}
+	}
+}
+
+// sinkOutputs computes, for each sink, the bytes that its filter chain
+// produces for line.
+func sinkOutputs(sinks []sink, line []byte) [][]byte {
+	outs := make([][]byte, len(sinks))
+
+	for i, s := range sinks {
+		outs[i] = applyFilterChain(s.filters, s.carries, line)
+	}
+
+	return outs
+}
+
+// flushSinkFilters drains every sink's filter chain (see
+// flushFilterChain) once stdin is exhausted, so a stateful filter (e.g.
+// --json-lines holding an unterminated last line) still emits it.
+func flushSinkFilters(sinks []sink, pool *sinkPool) error {
+	outs := make([][]byte, len(sinks))
+	for i, s := range sinks {
+		outs[i] = flushFilterChain(s.filters, s.carries)
+	}
+
+	if pool != nil {
+		pool.broadcast(outs)
+		return nil
+	}
+
+	for i, s := range sinks {
+		if len(outs[i]) == 0 {
+			continue
+		}
+
+		if _, writeErr := s.writer.Write(outs[i]); writeErr != nil {
+			return fmt.Errorf("file write error: %w", writeErr)
+		}
+	}
+
+	return nil
+}
+
+// runBinary is the --binary copy loop: fixed-size chunks via io.ReadFull,
+// fanned out unchanged to stdout and through each sink's filter chain
+// (filters that need it, e.g. --strip-ansi, hold back partial escape
+// sequences across chunk boundaries; see filter.go).
+func runBinary(stdin io.Reader, stdout *bufio.Writer, sinks []sink, bufferSize int, pool *sinkPool) error {
+	buf := make([]byte, bufferSize)
+
+	writeOuts := func(outs [][]byte) error {
+		if pool != nil {
+			pool.broadcast(outs)
+			return nil
+		}
+
+		for i, s := range sinks {
+			if len(outs[i]) == 0 {
+				continue
+			}
+
+			if _, writeErr := s.writer.Write(outs[i]); writeErr != nil {
+				return fmt.Errorf("file write error: %w", writeErr)
+			}
+		}
+
+		return nil
+	}
+
+	for {
+		n, readErr := io.ReadFull(stdin, buf)
+		chunk := buf[:n]
+
+		if n > 0 {
+			if _, writeErr := stdout.Write(chunk); writeErr != nil {
+				return fmt.Errorf("stdout write error: %w", writeErr)
+			}
+
+			if writeErr := writeOuts(sinkOutputs(sinks, chunk)); writeErr != nil {
+				return writeErr
+			}
+		}
+
+		if readErr != nil {
+			if errors.Is(readErr, io.EOF) || errors.Is(readErr, io.ErrUnexpectedEOF) {
+				outs := make([][]byte, len(sinks))
+				for i, s := range sinks {
+					outs[i] = flushFilterChain(s.filters, s.carries)
+				}
+
+				return writeOuts(outs)
+			}
+
+			return fmt.Errorf("read error: %w", readErr)
+		}
 	}
-	
-	file, err := os.OpenFile(path, flags, 0o644)
+}
+
+// isStdoutTTY reports whether os.Stdout is a terminal, which gates
+// --interactive (non-TTY invocations, e.g. piping to a file, always keep
+// today's non-interactive behavior).
+func isStdoutTTY() bool {
+	info, err := os.Stdout.Stat()
 	if err != nil {
-		return nil, err
+		return false
 	}
-	
-	return file, nil
+
+	return info.Mode()&os.ModeCharDevice != 0
 }
 
 func main() {
-	ignoreInterrupts, targets, err := parseArgs(os.Args[1:])
-	
+	opts, targets, err := parseArgs(os.Args[1:])
+
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s: %v\n", appName, err)
 		fmt.Fprintf(os.Stderr, "Try '%s --help' for more information.\n", appName)
 		os.Exit(2)
 	}
-	
-	if ignoreInterrupts {
+
+	// --interactive only takes effect when stdout is a TTY; otherwise chi
+	// behaves exactly as before.
+	interactive := opts.interactive && isStdoutTTY()
+
+	if opts.ignoreInterrupts && !interactive {
 		// Ignore SIGINT (Ctrl+C) and SIGTERM (common "interrupt-ish" signal).
 		// If you want SIGTERM to still terminate, remove syscall.SIGTERM here.
+		// (Interactive mode installs its own, narrower signal handling; see
+		// runInteractive in repl.go.)
 		channels := make(chan os.Signal, 1)
 		signal.Notify(channels, os.Interrupt, syscall.SIGTERM)
-		
+
 		go func() {
 			for range channels {
 				// Do nothing (ignoring)
 			}
 		}()
 	}
-	
-	// Open all output files first
-	type sink struct {
-		mode   fileMode
-		writer *bufio.Writer
-		file   *os.File
-	}
+
+	// Open all sink backends first (local files or registered URI schemes)
 	sinks := make([]sink, 0, len(targets))
-	
+
 	for _, tgt := range targets {
-		file, openErr := openTarget(tgt.path, tgt.append)
+		backend, openErr := openTargetSink(tgt)
 		if openErr != nil {
 			fmt.Fprintf(os.Stderr, "%s: cannot open '%s': %v\n", appName, tgt.path, openErr)
 			os.Exit(1)
 		}
-		
+
+		filters, filterErr := resolveFilterChain(tgt.filterNames)
+		if filterErr != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", appName, filterErr)
+			os.Exit(1)
+		}
+
 		sinks = append(sinks, sink{
-			mode:   tgt.mode,
-			writer: bufio.NewWriterSize(file, 64 * 1024),
-			file:   file,
+			filters: filters,
+			carries: make([][]byte, len(filters)),
+			writer:  bufio.NewWriterSize(backend, sinkWriterBufferSize(backend)),
+			closer:  backend,
 		})
 	}
-	
-	// Ensure close
-	defer func() {
-		for _, sink := range sinks {
-			_ = sink.writer.Flush()
-			_ = sink.file.Close()
-		}
-	}()
-	
-	stdout := bufio.NewWriterSize(os.Stdout, 64 * 1024)
-	defer stdout.Flush()
-	
-	stdin := bufio.NewReaderSize(os.Stdin, 64 * 1024)
-	
-	for {
-		// keeps '\n' if present
-		line, readErr := stdin.ReadBytes('\n')
-		// assumes no case of (readErr != nil) && (len(line) > 0) here
-		
-		if readErr != nil {
-			// EOF is normal termination; anything else is an error.
-			if errors.Is(readErr, os.ErrClosed) {
-				break
-			}
-			
-			// bufio.Reader returns io.EOF at end; compare by string to avoid extra import.
-			if readErr.Error() == "EOF" {
-				break
-			}
-			
-			fmt.Fprintf(os.Stderr, "%s: read error: %v\n", appName, readErr)
-			os.Exit(1)
-		}
-		
-		if len(line) <= 0 {
-			continue
-		}
-		
-		// Always write raw to stdout (keeping ANSI escapes)
-		if _, writeErr := stdout.Write(line); writeErr != nil {
-			fmt.Fprintf(os.Stderr, "%s: stdout write error: %v\n", appName, writeErr)
+
+	if interactive {
+		if err := runInteractive(opts, targets, sinks); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", appName, err)
 			os.Exit(1)
 		}
-		
-		// Write to each file sink with per-file mode
-		for _, sink := range sinks {
-			var out []byte
-			if sink.mode == modeBare {
-				out = line
-			} else {
-				// care: strip ANSI escapes
-				out = ansiEscapeRegExpr.ReplaceAll(line, nil)
-			}
-			
-			if _, writeErr := sink.writer.Write(out); writeErr != nil {
-				fmt.Fprintf(os.Stderr, "%s: file write error: %v\n", appName, writeErr)
-				os.Exit(1)
-			}
-		}
+
+		return
+	}
+
+	stdout := bufio.NewWriterSize(os.Stdout, 64*1024)
+
+	var pool *sinkPool
+	if opts.parallel {
+		pool = newSinkPool(sinks, opts.parallelCap, opts.maxBuffer)
 	}
-	
-	// Flush sinks explicitly (defer also does it)
+
+	var runErr error
+	if opts.binary {
+		runErr = runBinary(os.Stdin, stdout, sinks, opts.bufferSize, pool)
+	} else {
+		stdin := bufio.NewReaderSize(os.Stdin, 64*1024)
+		runErr = runLines(stdin, stdout, sinks, pool)
+	}
+
+	// Wait for every queued write to be issued before flushing the
+	// underlying *bufio.Writer for each sink below.
+	if pool != nil {
+		pool.close()
+	}
+
+	failed := runErr != nil
+	if runErr != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", appName, runErr)
+	}
+
 	if err := stdout.Flush(); err != nil {
 		fmt.Fprintf(os.Stderr, "%s: stdout flush error: %v\n", appName, err)
-		os.Exit(1)
+		failed = true
 	}
-	
-	for _, sink := range sinks {
-		if err := sink.writer.Flush(); err != nil {
+
+	// Flush and close every sink, regardless of what happened to any other
+	// sink in this same loop: a --parallel sink dropped by the pool (see
+	// pool.go) already reported its own write error in drain and has
+	// nothing left worth flushing, but every other sink still needs its
+	// buffered data flushed through. Exiting non-zero mid-loop here would
+	// skip the sinks ordered after the failing one, silently losing their
+	// still-buffered data — so note the failure and keep going instead.
+	for i, s := range sinks {
+		if pool != nil && pool.failed[i].Load() {
+			_ = s.closer.Close()
+			continue
+		}
+
+		if err := s.writer.Flush(); err != nil {
 			fmt.Fprintf(os.Stderr, "%s: file flush error: %v\n", appName, err)
-			os.Exit(1)
+			failed = true
 		}
+
+		_ = s.closer.Close()
+	}
+
+	if failed {
+		os.Exit(1)
 	}
-	
-	// A tiny sanity check to avoid "unused import" if you tweak later:
-	_ = bytes.Compare
 }
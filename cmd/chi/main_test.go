@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestStripANSICarrySplitEscape exercises the bug class --binary mode was
+// added to fix: an ANSI CSI sequence split across two chunk boundaries must
+// still be stripped, not leaked into the output as a dangling fragment.
+func TestStripANSICarrySplitEscape(t *testing.T) {
+	full := []byte("red\x1b[31mtext\x1b[0m\n")
+
+	for split := 0; split <= len(full); split++ {
+		var carry []byte
+
+		out := stripANSICarry(full[:split], &carry, false)
+		out = append(out, stripANSICarry(full[split:], &carry, true)...)
+
+		want := "redtext\n"
+		if string(out) != want {
+			t.Errorf("split at %d: got %q, want %q", split, out, want)
+		}
+
+		if len(carry) != 0 {
+			t.Errorf("split at %d: carry not drained after final call: %q", split, carry)
+		}
+	}
+}
+
+// TestStripANSICarryLoneEscapeAtEOF checks that a truncated escape sequence
+// still present when the stream ends (final=true) is emitted as-is rather
+// than silently dropped.
+func TestStripANSICarryLoneEscapeAtEOF(t *testing.T) {
+	var carry []byte
+
+	out := stripANSICarry([]byte("ok\x1b["), &carry, false)
+	if !bytes.Equal(out, []byte("ok")) {
+		t.Fatalf("got %q, want %q", out, "ok")
+	}
+	if string(carry) != "\x1b[" {
+		t.Fatalf("expected incomplete sequence held in carry, got %q", carry)
+	}
+
+	out = stripANSICarry(nil, &carry, true)
+	if string(out) != "\x1b[" {
+		t.Fatalf("final call: got %q, want %q", out, "\x1b[")
+	}
+}
@@ -0,0 +1,136 @@
+// pool.go implements the optional parallel sink fan-out (--parallel),
+// borrowed from the sequencer pattern used by cmd/gofmt: each sink gets its
+// own goroutine and buffered queue so a slow sink (e.g. a network-mounted
+// file) can't stall stdout or the other sinks, while a weighted semaphore
+// caps total in-flight bytes so a stalled sink doesn't grow memory without
+// bound.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/sync/semaphore"
+)
+
+const (
+	// sinkQueueDepth is the number of pending chunks buffered per sink
+	// before broadcast blocks on that sink's queue.
+	sinkQueueDepth = 64
+
+	// defaultMaxBuffer is the --max-buffer default: the total number of
+	// in-flight bytes allowed across all sinks at once.
+	defaultMaxBuffer = 8 * defaultBufferSize
+)
+
+// sinkPool fans chunks out to sinks concurrently. Per-sink ordering is
+// preserved (each sink has exactly one drain goroutine reading its own
+// queue in order); only the *writing* across sinks happens in parallel.
+// queuedChunk is one sink queue entry: the bytes to write, plus the byteSem
+// weight that was actually acquired for it (see broadcast — a chunk larger
+// than maxBuffer is clamped to maxBuffer so the acquire can't block
+// forever, and drain must release that same clamped weight back).
+type queuedChunk struct {
+	data   []byte
+	weight int64
+}
+
+type sinkPool struct {
+	workSem   *semaphore.Weighted // bounds concurrently-active writes (--parallel)
+	byteSem   *semaphore.Weighted // bounds total in-flight bytes (--max-buffer)
+	maxBuffer int64
+	queues    []chan queuedChunk
+	failed    []atomic.Bool
+	wg        sync.WaitGroup
+}
+
+// newSinkPool starts one drain goroutine per sink. cap is the --parallel
+// worker cap; maxBuffer is the --max-buffer byte cap.
+func newSinkPool(sinks []sink, cap int, maxBuffer int) *sinkPool {
+	p := &sinkPool{
+		workSem:   semaphore.NewWeighted(int64(cap)),
+		byteSem:   semaphore.NewWeighted(int64(maxBuffer)),
+		maxBuffer: int64(maxBuffer),
+		queues:    make([]chan queuedChunk, len(sinks)),
+		failed:    make([]atomic.Bool, len(sinks)),
+	}
+
+	for i := range sinks {
+		p.queues[i] = make(chan queuedChunk, sinkQueueDepth)
+		p.wg.Add(1)
+
+		go p.drain(i, sinks[i])
+	}
+
+	return p
+}
+
+func (p *sinkPool) drain(i int, s sink) {
+	defer p.wg.Done()
+
+	for qc := range p.queues[i] {
+		if !p.failed[i].Load() {
+			_ = p.workSem.Acquire(context.Background(), 1)
+			_, err := s.writer.Write(qc.data)
+			p.workSem.Release(1)
+
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: file write error, dropping sink: %v\n", appName, err)
+				p.failed[i].Store(true)
+			}
+		}
+
+		p.byteSem.Release(qc.weight)
+	}
+}
+
+// broadcast enqueues outs[i] to sink i's queue for every sink, where outs
+// has already been computed per-sink (e.g. ANSI-stripped for --care sinks).
+// A nil or empty entry is skipped. Acquiring byteSem before enqueueing
+// applies backpressure instead of buffering without bound when a sink is
+// behind.
+//
+// Each entry is copied before it's queued: a bare (no-op filter chain) sink
+// in --binary mode gets back the same slice runBinary read into, and that
+// slice is reused on the next io.ReadFull once this call returns, so the
+// drain goroutine reading it concurrently would otherwise race with (and
+// see data clobbered by) the next chunk.
+//
+// The acquired weight is clamped to maxBuffer: semaphore.Acquire blocks
+// forever for a request larger than the semaphore's own size, so a single
+// chunk bigger than --max-buffer (e.g. a large --buffer-size with a small
+// --max-buffer) would otherwise hang the process instead of just using the
+// whole budget for that one chunk. parseArgs already rejects/fixes up that
+// combination at startup; this clamp is the last line of defense.
+func (p *sinkPool) broadcast(outs [][]byte) {
+	for i, out := range outs {
+		if len(out) == 0 || p.failed[i].Load() {
+			continue
+		}
+
+		buf := append([]byte(nil), out...)
+
+		weight := int64(len(buf))
+		if weight > p.maxBuffer {
+			weight = p.maxBuffer
+		}
+
+		_ = p.byteSem.Acquire(context.Background(), weight)
+		p.queues[i] <- queuedChunk{data: buf, weight: weight}
+	}
+}
+
+// close drains and waits for every sink's queue, so that by the time it
+// returns all writes have been issued (ready for the caller to flush the
+// underlying *bufio.Writer).
+func (p *sinkPool) close() {
+	for _, q := range p.queues {
+		close(q)
+	}
+
+	p.wg.Wait()
+}
@@ -0,0 +1,349 @@
+// repl.go implements --interactive: a readline-based REPL, following the
+// interactive shell pattern in fq's pkg/cli/cli.go. Incoming stdin lines are
+// printed above the user's in-progress prompt (instead of clobbering it),
+// and the user can type commands to manage sinks live without restarting
+// chi. Only reachable when stdout is a TTY (see isStdoutTTY in main.go);
+// non-TTY invocations never touch this file.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/ergochat/readline"
+	"golang.org/x/term"
+)
+
+// managedSink is a sink plus the bookkeeping --interactive needs to
+// pause/resume/drop/rotate it live.
+type managedSink struct {
+	name   string
+	target targetFile
+	sink   sink
+	paused bool
+}
+
+// sinkManager is the mutex-protected set of live sinks for --interactive
+// mode: mutated by REPL commands, read by the stdin pump goroutine on every
+// line.
+type sinkManager struct {
+	mu    sync.Mutex
+	sinks []*managedSink
+}
+
+func newSinkManager(targets []targetFile, sinks []sink) *sinkManager {
+	mgr := &sinkManager{sinks: make([]*managedSink, len(targets))}
+
+	for i, tgt := range targets {
+		mgr.sinks[i] = &managedSink{name: tgt.path, target: tgt, sink: sinks[i]}
+	}
+
+	return mgr
+}
+
+func (m *sinkManager) find(name string) *managedSink {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, ms := range m.sinks {
+		if ms.name == name {
+			return ms
+		}
+	}
+
+	return nil
+}
+
+// write fans line out to every non-paused sink, same as the non-interactive
+// copy loops in main.go.
+func (m *sinkManager) write(line []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, ms := range m.sinks {
+		if ms.paused {
+			continue
+		}
+
+		out := applyFilterChain(ms.sink.filters, ms.sink.carries, line)
+
+		if _, err := ms.sink.writer.Write(out); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: file write error on %s: %v\n", appName, ms.name, err)
+		}
+	}
+}
+
+func (m *sinkManager) add(path string) error {
+	tgt := targetFile{path: path}
+
+	backend, err := openTargetSink(tgt)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sinks = append(m.sinks, &managedSink{
+		name:   path,
+		target: tgt,
+		sink: sink{
+			writer: bufio.NewWriterSize(backend, sinkWriterBufferSize(backend)),
+			closer: backend,
+		},
+	})
+
+	return nil
+}
+
+func (m *sinkManager) drop(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, ms := range m.sinks {
+		if ms.name != name {
+			continue
+		}
+
+		_ = ms.sink.writer.Flush()
+		_ = ms.sink.closer.Close()
+		m.sinks = append(m.sinks[:i], m.sinks[i+1:]...)
+
+		return nil
+	}
+
+	return fmt.Errorf("no such sink: %s", name)
+}
+
+func (m *sinkManager) setPaused(name string, paused bool) error {
+	ms := m.find(name)
+	if ms == nil {
+		return fmt.Errorf("no such sink: %s", name)
+	}
+
+	m.mu.Lock()
+	ms.paused = paused
+	m.mu.Unlock()
+
+	return nil
+}
+
+func (m *sinkManager) flush() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, ms := range m.sinks {
+		if err := ms.sink.writer.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rotate triggers an out-of-schedule rotation of a --rotate-size/
+// --rotate-interval file sink; it's a no-op-or-error for every other sink
+// kind.
+func (m *sinkManager) rotate(name string) error {
+	ms := m.find(name)
+	if ms == nil {
+		return fmt.Errorf("no such sink: %s", name)
+	}
+
+	rs, ok := ms.sink.closer.(*rotatingFileSink)
+	if !ok {
+		return fmt.Errorf("%s: not a rotating file sink (pass --rotate-size or --rotate-interval)", name)
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	return rs.rotate()
+}
+
+func (m *sinkManager) close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, ms := range m.sinks {
+		_ = ms.sink.writer.Flush()
+		_ = ms.sink.closer.Close()
+	}
+}
+
+// runInteractive drives the --interactive REPL until stdin reaches EOF or
+// the user exits the prompt.
+func runInteractive(opts options, targets []targetFile, sinks []sink) error {
+	mgr := newSinkManager(targets, sinks)
+	defer mgr.close()
+
+	// readline defaults to os.Stdin, but os.Stdin here is the data stream
+	// pumpStdin is concurrently reading (stdout being a TTY with stdin
+	// piped is exactly the documented use of --interactive). Reading REPL
+	// keystrokes from the controlling terminal instead keeps the two
+	// readers on genuinely separate file descriptors.
+	//
+	// Config.Stdin alone isn't enough: readline's default FuncIsTerminal,
+	// FuncMakeRaw and FuncExitRaw all hardcode syscall.Stdin (fd 0), which
+	// under --interactive is the piped data stream, not the terminal. Pin
+	// all three to the tty's own fd so raw-mode handling targets the same
+	// descriptor readline is actually reading from.
+	tty, err := os.OpenFile("/dev/tty", os.O_RDONLY, 0)
+	if err != nil {
+		return fmt.Errorf("interactive: opening /dev/tty for REPL input: %w", err)
+	}
+	defer tty.Close()
+
+	ttyFd := int(tty.Fd())
+	var ttyState *term.State
+
+	rl, err := readline.NewFromConfig(&readline.Config{
+		Prompt:         appName + "> ",
+		Stdin:          tty,
+		FuncIsTerminal: func() bool { return term.IsTerminal(ttyFd) },
+		FuncMakeRaw: func() error {
+			state, rawErr := term.MakeRaw(ttyFd)
+			if rawErr != nil {
+				return rawErr
+			}
+			ttyState = state
+			return nil
+		},
+		FuncExitRaw: func() error {
+			if ttyState == nil {
+				return nil
+			}
+			return term.Restore(ttyFd, ttyState)
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("interactive: %w", err)
+	}
+	defer rl.Close()
+
+	// readline already cancels just the in-progress prompt line on SIGINT
+	// (Readline returns readline.ErrInterrupt), unlike the non-interactive
+	// --ignore-interrupts path, which installs a goroutine that swallows
+	// SIGINT/SIGTERM process-wide forever. Here --ignore-interrupts only
+	// extends that same "don't tear down mid-input" treatment to SIGTERM,
+	// via our own interruptChan, kept separate from the OS signal channel
+	// itself (mirroring fq's separation of the two).
+	var interruptChan chan struct{}
+	if opts.ignoreInterrupts {
+		osSignals := make(chan os.Signal, 1)
+		signal.Notify(osSignals, syscall.SIGTERM)
+		defer signal.Stop(osSignals)
+
+		interruptChan = make(chan struct{}, 1)
+
+		go func() {
+			for range osSignals {
+				select {
+				case interruptChan <- struct{}{}:
+				default:
+				}
+			}
+		}()
+	}
+
+	go pumpStdin(os.Stdin, rl, mgr)
+
+	for {
+		line, readErr := rl.Readline()
+
+		select {
+		case <-interruptChan:
+			continue
+		default:
+		}
+
+		switch {
+		case errors.Is(readErr, readline.ErrInterrupt):
+			continue
+		case errors.Is(readErr, io.EOF):
+			return nil
+		case readErr != nil:
+			return fmt.Errorf("interactive: %w", readErr)
+		}
+
+		handleCommand(strings.TrimSpace(line), mgr, rl)
+	}
+}
+
+// pumpStdin reads stdin line-by-line for as long as the REPL is running,
+// printing each line above the prompt and fanning it out to the live sinks.
+func pumpStdin(stdin io.Reader, rl *readline.Instance, mgr *sinkManager) {
+	reader := bufio.NewReaderSize(stdin, 64*1024)
+
+	for {
+		line, readErr := reader.ReadBytes('\n')
+
+		if len(line) > 0 {
+			fmt.Fprint(rl.Stdout(), string(line))
+			mgr.write(line)
+		}
+
+		if readErr != nil {
+			return
+		}
+	}
+}
+
+// handleCommand parses and runs one REPL command line (":flush",
+// ":rotate <sink>", ":pause <sink>", ":resume <sink>", ":add <path>",
+// ":drop <sink>"). Anything not starting with ":" is reported as unknown.
+func handleCommand(line string, mgr *sinkManager, rl *readline.Instance) {
+	if line == "" {
+		return
+	}
+
+	if !strings.HasPrefix(line, ":") {
+		fmt.Fprintf(rl.Stdout(), "%s: commands start with ':' (try :flush, :add <path>, ...)\n", appName)
+		return
+	}
+
+	fields := strings.Fields(line[1:])
+	if len(fields) == 0 {
+		return
+	}
+
+	cmd, args := fields[0], fields[1:]
+
+	var err error
+	switch cmd {
+	case "flush":
+		err = mgr.flush()
+	case "rotate":
+		err = withOneArg(args, mgr.rotate)
+	case "pause":
+		err = withOneArg(args, func(name string) error { return mgr.setPaused(name, true) })
+	case "resume":
+		err = withOneArg(args, func(name string) error { return mgr.setPaused(name, false) })
+	case "add":
+		err = withOneArg(args, mgr.add)
+	case "drop":
+		err = withOneArg(args, mgr.drop)
+	default:
+		err = fmt.Errorf("unknown command: :%s", cmd)
+	}
+
+	if err != nil {
+		fmt.Fprintf(rl.Stdout(), "%s: %v\n", appName, err)
+	}
+}
+
+func withOneArg(args []string, fn func(string) error) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected exactly one argument")
+	}
+
+	return fn(args[0])
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestRotatingFileSinkArchivesWithoutDataLoss covers the bug the maintainer
+// reported: writes spanning many rotations must all land somewhere on disk
+// (live file + archives), byte for byte, with no archive silently clobbered
+// by the next one.
+func TestRotatingFileSinkArchivesWithoutDataLoss(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rot.log")
+
+	s, err := newRotatingFileSink(path, false, 0o644, rotateConfig{
+		enabled:   true,
+		sizeBytes: 1024,
+		scheme:    rotateSchemeNumeric,
+	})
+	if err != nil {
+		t.Fatalf("newRotatingFileSink: %v", err)
+	}
+
+	var total int
+	chunk := make([]byte, 100)
+	for i := range chunk {
+		chunk[i] = 'x'
+	}
+
+	for i := 0; i < 50; i++ {
+		n, writeErr := s.Write(chunk)
+		if writeErr != nil {
+			t.Fatalf("Write: %v", writeErr)
+		}
+		total += n
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	matches, err := filepath.Glob(path + "*")
+	if err != nil {
+		t.Fatalf("Glob: %v", err)
+	}
+	if len(matches) < 2 {
+		t.Fatalf("expected at least one archive plus the live file, got %v", matches)
+	}
+
+	var onDisk int64
+	for _, m := range matches {
+		info, statErr := os.Stat(m)
+		if statErr != nil {
+			t.Fatalf("Stat %s: %v", m, statErr)
+		}
+		onDisk += info.Size()
+	}
+
+	if onDisk != int64(total) {
+		t.Fatalf("data loss across rotation: wrote %d bytes, found %d on disk", total, onDisk)
+	}
+}
+
+// TestRotatingFileSinkPrune checks that prune keeps only the newest keep
+// archives and removes the rest.
+func TestRotatingFileSinkPrune(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rot.log")
+
+	s, err := newRotatingFileSink(path, false, 0o644, rotateConfig{
+		enabled:   true,
+		sizeBytes: 10,
+		keep:      2,
+		scheme:    rotateSchemeNumeric,
+	})
+	if err != nil {
+		t.Fatalf("newRotatingFileSink: %v", err)
+	}
+	defer s.Close()
+
+	for i := 0; i < 10; i++ {
+		if _, err := s.Write([]byte("0123456789")); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatalf("Glob: %v", err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("expected exactly 2 archives kept, got %d: %v", len(matches), matches)
+	}
+}
@@ -0,0 +1,315 @@
+// sink.go implements pluggable sink backends, addressed by URI, similar to
+// how restic and fq register multiple storage/format backends. A FILE
+// argument that matches "scheme://..." is dispatched to a registered
+// SinkOpener; anything else falls back to the historical os.OpenFile
+// behavior (openFileSink).
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink is a writable destination chi can tee to: a local file, a network
+// socket, an HTTP endpoint, etc. Close is always called exactly once at
+// shutdown, even for destinations (like udp://) where it is a no-op.
+type Sink interface {
+	io.Writer
+	io.Closer
+}
+
+// SinkOpener opens a Sink for a parsed URI. tgt carries the FILE_OPTS that
+// applied to this argument (append/mode), which an opener may honor as a
+// default where the URI doesn't override it via query parameters.
+type SinkOpener func(u *url.URL, tgt targetFile) (Sink, error)
+
+var (
+	sinkRegistryMu sync.RWMutex
+	sinkRegistry   = map[string]SinkOpener{}
+)
+
+// RegisterScheme registers an opener for a URI scheme (e.g. "tcp"), so
+// third parties and tests can extend chi with new FILE destinations beyond
+// the built-ins (file, tcp, unix, udp, http, https, fd).
+func RegisterScheme(scheme string, opener SinkOpener) {
+	sinkRegistryMu.Lock()
+	defer sinkRegistryMu.Unlock()
+
+	sinkRegistry[scheme] = opener
+}
+
+func lookupScheme(scheme string) (SinkOpener, bool) {
+	sinkRegistryMu.RLock()
+	defer sinkRegistryMu.RUnlock()
+
+	opener, ok := sinkRegistry[scheme]
+	return opener, ok
+}
+
+func init() {
+	RegisterScheme("file", openFileURISink)
+	RegisterScheme("tcp", openTCPSink)
+	RegisterScheme("unix", openUnixSink)
+	RegisterScheme("udp", openUDPSink)
+	RegisterScheme("http", openHTTPSink)
+	RegisterScheme("https", openHTTPSink)
+	RegisterScheme("fd", openFDSink)
+}
+
+// sinkURIRegExpr matches the leading "scheme://" of a FILE argument, per
+// the URI scheme grammar (RFC 3986 S3.1). Plain paths like "out.log" or
+// "./dir/out.log" never match this and fall back to openFileSink.
+var sinkURIRegExpr = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.-]*://`)
+
+// openTargetSink opens the backend for one parsed FILE argument, dispatching
+// to a registered scheme opener when the path looks like a URI.
+func openTargetSink(tgt targetFile) (Sink, error) {
+	if sinkURIRegExpr.MatchString(tgt.path) {
+		u, err := url.Parse(tgt.path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sink URI %q: %w", tgt.path, err)
+		}
+
+		opener, ok := lookupScheme(u.Scheme)
+		if !ok {
+			return nil, fmt.Errorf("unknown sink scheme: %s://", u.Scheme)
+		}
+
+		return opener(u, tgt)
+	}
+
+	return openFileSink(tgt.path, tgt.append, 0o644, tgt.rotate)
+}
+
+// openFileSink is today's plain-path behavior: truncate or append a local
+// file. If rotate is enabled, the returned Sink also handles size/time
+// rotation (see rotate.go).
+func openFileSink(path string, appendMode bool, mode os.FileMode, rotate rotateConfig) (Sink, error) {
+	if rotate.enabled {
+		return newRotatingFileSink(path, appendMode, mode, rotate)
+	}
+
+	return openRawFile(path, appendMode, mode)
+}
+
+// openRawFile opens path with chi's usual truncate-or-append flags, with no
+// rotation involved.
+func openRawFile(path string, appendMode bool, mode os.FileMode) (*os.File, error) {
+	flags := os.O_CREATE | os.O_WRONLY
+
+	if appendMode {
+		flags |= os.O_APPEND
+	} else {
+		flags |= os.O_TRUNC
+	}
+
+	return os.OpenFile(path, flags, mode)
+}
+
+// uriPath picks the most sensible "path" component out of a URI that may
+// have been written as file:///abs/path, file://relative/path or
+// file:relative/path.
+func uriPath(u *url.URL) string {
+	switch {
+	case u.Path != "":
+		return u.Path
+	case u.Opaque != "":
+		return u.Opaque
+	default:
+		return u.Host
+	}
+}
+
+// openFileURISink is the file:// scheme opener. Query parameters override
+// the FILE_OPTS defaults: ?append=1 and ?mode=0600 (octal, like chmod).
+func openFileURISink(u *url.URL, tgt targetFile) (Sink, error) {
+	path := uriPath(u)
+	if path == "" {
+		return nil, fmt.Errorf("file:// URI has no path: %s", u.String())
+	}
+
+	appendMode := tgt.append
+	if v := u.Query().Get("append"); v != "" {
+		appendMode = v == "1" || strings.EqualFold(v, "true")
+	}
+
+	mode := os.FileMode(0o644)
+	if v := u.Query().Get("mode"); v != "" {
+		parsed, err := strconv.ParseUint(v, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("file:// invalid ?mode=%s: %w", v, err)
+		}
+		mode = os.FileMode(parsed)
+	}
+
+	return openFileSink(path, appendMode, mode, tgt.rotate)
+}
+
+// reconnectingSink wraps a net.Conn, redialing with exponential backoff on
+// a write error when retry is set (tcp://host:port?retry=1). Without
+// retry, a write error is returned as-is, same as any other sink.
+type reconnectingSink struct {
+	dial  func() (net.Conn, error)
+	retry bool
+
+	mu      sync.Mutex
+	conn    net.Conn
+	backoff time.Duration
+}
+
+func (s *reconnectingSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, err := s.conn.Write(p)
+	if err == nil || !s.retry {
+		return n, err
+	}
+
+	_ = s.conn.Close()
+
+	conn, dialErr := s.redial()
+	if dialErr != nil {
+		return n, dialErr
+	}
+	s.conn = conn
+
+	return s.conn.Write(p)
+}
+
+func (s *reconnectingSink) redial() (net.Conn, error) {
+	backoff := s.backoff
+	if backoff <= 0 {
+		backoff = 100 * time.Millisecond
+	}
+	time.Sleep(backoff)
+
+	s.backoff = backoff * 2
+	if s.backoff > 5*time.Second {
+		s.backoff = 5 * time.Second
+	}
+
+	return s.dial()
+}
+
+func (s *reconnectingSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.conn.Close()
+}
+
+// openTCPSink is the tcp://host:port opener.
+func openTCPSink(u *url.URL, tgt targetFile) (Sink, error) {
+	dial := func() (net.Conn, error) { return net.Dial("tcp", u.Host) }
+
+	conn, err := dial()
+	if err != nil {
+		return nil, fmt.Errorf("tcp dial %s: %w", u.Host, err)
+	}
+
+	return &reconnectingSink{
+		dial:  dial,
+		retry: u.Query().Get("retry") == "1",
+		conn:  conn,
+	}, nil
+}
+
+// openUnixSink is the unix://path opener.
+func openUnixSink(u *url.URL, tgt targetFile) (Sink, error) {
+	path := uriPath(u)
+
+	dial := func() (net.Conn, error) { return net.Dial("unix", path) }
+
+	conn, err := dial()
+	if err != nil {
+		return nil, fmt.Errorf("unix dial %s: %w", path, err)
+	}
+
+	return &reconnectingSink{
+		dial:  dial,
+		retry: u.Query().Get("retry") == "1",
+		conn:  conn,
+	}, nil
+}
+
+// openUDPSink is the udp://host:port opener. UDP is connectionless and
+// message-oriented, so each Write is naturally sent as its own datagram
+// (one per line in text mode, one per chunk in --binary mode).
+func openUDPSink(u *url.URL, tgt targetFile) (Sink, error) {
+	conn, err := net.Dial("udp", u.Host)
+	if err != nil {
+		return nil, fmt.Errorf("udp dial %s: %w", u.Host, err)
+	}
+
+	return conn, nil
+}
+
+// httpSink streams writes as the chunked-transfer body of a single POST
+// request, opened once and kept open for the sink's lifetime.
+type httpSink struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+// openHTTPSink is the http:// and https:// opener: POSTs a streaming,
+// chunked-transfer body (via io.Pipe) so each Write reaches the server as
+// soon as it happens, without chi having to buffer the whole stream.
+func openHTTPSink(u *url.URL, tgt targetFile) (Sink, error) {
+	pr, pw := io.Pipe()
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), pr)
+	if err != nil {
+		return nil, fmt.Errorf("http request %s: %w", u.String(), err)
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	req.ContentLength = -1 // force chunked transfer encoding
+
+	done := make(chan error, 1)
+	go func() {
+		resp, postErr := http.DefaultClient.Do(req)
+		if postErr != nil {
+			done <- postErr
+			return
+		}
+		_ = resp.Body.Close()
+		done <- nil
+	}()
+
+	return &httpSink{pw: pw, done: done}, nil
+}
+
+func (s *httpSink) Write(p []byte) (int, error) {
+	return s.pw.Write(p)
+}
+
+func (s *httpSink) Close() error {
+	if err := s.pw.Close(); err != nil {
+		return err
+	}
+
+	return <-s.done
+}
+
+// openFDSink is the fd://N opener: writes to an inherited file descriptor.
+func openFDSink(u *url.URL, tgt targetFile) (Sink, error) {
+	numStr := uriPath(u)
+	numStr = strings.TrimPrefix(numStr, "/")
+
+	fd, err := strconv.Atoi(numStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fd URI %q: %w", u.String(), err)
+	}
+
+	return os.NewFile(uintptr(fd), fmt.Sprintf("fd/%d", fd)), nil
+}